@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// vexFormat identifica el esquema de un documento VEX, tanto en la entrada
+// (donde "auto" dispara la detección) como en la salida (donde fija el
+// formato de transcodificación deseado).
+type vexFormat string
+
+const (
+	formatAuto    vexFormat = "auto"
+	formatLegacy  vexFormat = "legacy"
+	formatOpenVEX vexFormat = "openvex"
+	formatCSAF    vexFormat = "csaf"
+)
+
+// openVEXContext es el @context que identifica un documento OpenVEX v0.2.0.
+const openVEXContext = "https://openvex.dev/ns/v0.2.0"
+
+// csafContext marca, en el modelo interno VEX, que Context vino de
+// transcodificar un documento CSAF (que no tiene @context propio). No es un
+// valor válido de @context legacy: encodeVEX lo limpia antes de emitir
+// legacy/auto para no filtrar un marcador interno a la salida.
+const csafContext = "csaf-vex-2.0"
+
+// parseVexFormat valida el valor de -input-format/-output-format.
+func parseVexFormat(s string) (vexFormat, error) {
+	switch vexFormat(s) {
+	case formatAuto, formatLegacy, formatOpenVEX, formatCSAF:
+		return vexFormat(s), nil
+	default:
+		return "", fmt.Errorf("formato desconocido %q (se esperaba auto, legacy, openvex o csaf)", s)
+	}
+}
+
+// detectFormat inspecciona las claves de nivel superior del JSON decodificado
+// para distinguir entre el esquema "legacy Guac", OpenVEX y CSAF VEX 2.0, sin
+// asumir todavía la forma completa del documento.
+func detectFormat(data []byte) (vexFormat, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return "", fmt.Errorf("error al parsear JSON: %v", err)
+	}
+
+	if _, hasDocument := top["document"]; hasDocument {
+		if _, hasVulns := top["vulnerabilities"]; hasVulns {
+			return formatCSAF, nil
+		}
+	}
+
+	if ctxRaw, ok := top["@context"]; ok {
+		var ctx string
+		if err := json.Unmarshal(ctxRaw, &ctx); err == nil && strings.Contains(ctx, "openvex.dev") {
+			return formatOpenVEX, nil
+		}
+	}
+
+	if _, ok := top["statements"]; ok {
+		return formatLegacy, nil
+	}
+
+	return "", fmt.Errorf("no se pudo detectar el formato del documento VEX")
+}
+
+// decodeVEX decodifica data al modelo interno VEX según format. Si format es
+// formatAuto (o vacío), primero detecta el esquema con detectFormat. Devuelve
+// el formato efectivamente usado para que el caller pueda transcodificar de
+// vuelta al mismo esquema por defecto.
+func decodeVEX(data []byte, format vexFormat) (VEX, vexFormat, error) {
+	if format == formatAuto || format == "" {
+		detected, err := detectFormat(data)
+		if err != nil {
+			return VEX{}, "", err
+		}
+		format = detected
+	}
+
+	switch format {
+	case formatCSAF:
+		vex, err := decodeCSAF(data)
+		return vex, formatCSAF, err
+	case formatLegacy, formatOpenVEX:
+		var vex VEX
+		if err := json.Unmarshal(data, &vex); err != nil {
+			return VEX{}, "", fmt.Errorf("error al parsear JSON: %v", err)
+		}
+		return vex, format, nil
+	default:
+		return VEX{}, "", fmt.Errorf("formato de entrada desconocido %q", format)
+	}
+}
+
+// encodeVEX serializa vex en el esquema format, con la indentación usada en
+// el resto de la herramienta.
+func encodeVEX(vex VEX, format vexFormat) ([]byte, error) {
+	switch format {
+	case formatCSAF:
+		return json.MarshalIndent(buildCSAFDocument(vex), "", "  ")
+	case formatOpenVEX:
+		vex.Context = openVEXContext
+		return json.MarshalIndent(vex, "", "  ")
+	case formatLegacy, formatAuto, "":
+		if vex.Context == csafContext {
+			vex.Context = ""
+		}
+		return json.MarshalIndent(vex, "", "  ")
+	default:
+		return nil, fmt.Errorf("formato de salida desconocido %q", format)
+	}
+}
+
+// encodeVEXCompact serializa vex en el esquema format sin indentar, para los
+// sinks NDJSON donde cada documento debe caber en una sola línea.
+func encodeVEXCompact(vex VEX, format vexFormat) ([]byte, error) {
+	switch format {
+	case formatCSAF:
+		return json.Marshal(buildCSAFDocument(vex))
+	case formatOpenVEX:
+		vex.Context = openVEXContext
+		return json.Marshal(vex)
+	case formatLegacy, formatAuto, "":
+		if vex.Context == csafContext {
+			vex.Context = ""
+		}
+		return json.Marshal(vex)
+	default:
+		return nil, fmt.Errorf("formato de salida desconocido %q", format)
+	}
+}
+
+// csafDocument es un subconjunto mínimo de CSAF VEX 2.0: lo suficiente para
+// transcodificar desde/hacia el modelo interno VEX sin pretender cubrir todo
+// el esquema CSAF.
+type csafDocument struct {
+	Document struct {
+		Title    string `json:"title"`
+		Tracking struct {
+			ID                 string `json:"id"`
+			CurrentReleaseDate string `json:"current_release_date"`
+		} `json:"tracking"`
+	} `json:"document"`
+	Vulnerabilities []csafVulnerability `json:"vulnerabilities"`
+}
+
+type csafVulnerability struct {
+	CVE           string            `json:"cve"`
+	Title         string            `json:"title"`
+	ProductStatus csafProductStatus `json:"product_status"`
+}
+
+type csafProductStatus struct {
+	KnownAffected      []string `json:"known_affected,omitempty"`
+	KnownNotAffected   []string `json:"known_not_affected,omitempty"`
+	Fixed              []string `json:"fixed,omitempty"`
+	UnderInvestigation []string `json:"under_investigation,omitempty"`
+}
+
+// decodeCSAF convierte un documento CSAF VEX 2.0 al modelo interno VEX,
+// expandiendo cada entrada de product_status en un Statement propio.
+func decodeCSAF(data []byte) (VEX, error) {
+	var doc csafDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return VEX{}, fmt.Errorf("error al parsear CSAF: %v", err)
+	}
+
+	releaseDate := doc.Document.Tracking.CurrentReleaseDate
+	vex := VEX{
+		Context:     csafContext,
+		ID:          doc.Document.Tracking.ID,
+		Timestamp:   releaseDate,
+		LastUpdated: releaseDate,
+		Tooling:     doc.Document.Title,
+	}
+
+	for _, v := range doc.Vulnerabilities {
+		groups := []struct {
+			status   string
+			products []string
+		}{
+			{"affected", v.ProductStatus.KnownAffected},
+			{"not_affected", v.ProductStatus.KnownNotAffected},
+			{"fixed", v.ProductStatus.Fixed},
+			{"under_investigation", v.ProductStatus.UnderInvestigation},
+		}
+		for _, g := range groups {
+			for _, product := range g.products {
+				vex.Statements = append(vex.Statements, Statement{
+					Vulnerability: Vulnerability{ID: v.CVE, Name: v.CVE, Description: v.Title},
+					Status:        g.status,
+					Supplier:      product,
+					Timestamp:     releaseDate,
+					LastUpdated:   releaseDate,
+				})
+			}
+		}
+	}
+
+	return vex, nil
+}
+
+// buildCSAFDocument hace el camino inverso de decodeCSAF: agrupa los
+// statements del modelo interno por vulnerabilidad y reconstruye las listas
+// product_status por categoría.
+func buildCSAFDocument(vex VEX) csafDocument {
+	var doc csafDocument
+	doc.Document.Title = vex.Tooling
+	doc.Document.Tracking.ID = vex.ID
+	doc.Document.Tracking.CurrentReleaseDate = vex.Timestamp
+
+	byVuln := make(map[string]*csafVulnerability)
+	var order []string
+
+	for _, s := range vex.Statements {
+		key := s.Vulnerability.ID
+		if key == "" {
+			key = s.Vulnerability.Name
+		}
+		v, ok := byVuln[key]
+		if !ok {
+			v = &csafVulnerability{CVE: key, Title: s.Vulnerability.Description}
+			byVuln[key] = v
+			order = append(order, key)
+		}
+		switch s.Status {
+		case "affected":
+			v.ProductStatus.KnownAffected = append(v.ProductStatus.KnownAffected, s.Supplier)
+		case "not_affected":
+			v.ProductStatus.KnownNotAffected = append(v.ProductStatus.KnownNotAffected, s.Supplier)
+		case "fixed":
+			v.ProductStatus.Fixed = append(v.ProductStatus.Fixed, s.Supplier)
+		default:
+			v.ProductStatus.UnderInvestigation = append(v.ProductStatus.UnderInvestigation, s.Supplier)
+		}
+	}
+
+	for _, key := range order {
+		doc.Vulnerabilities = append(doc.Vulnerabilities, *byVuln[key])
+	}
+
+	return doc
+}
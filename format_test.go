@@ -0,0 +1,159 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    vexFormat
+		wantErr bool
+	}{
+		{
+			name: "legacy",
+			data: `{"@context":"legacy-vex","statements":[]}`,
+			want: formatLegacy,
+		},
+		{
+			name: "openvex",
+			data: `{"@context":"https://openvex.dev/ns/v0.2.0","statements":[]}`,
+			want: formatOpenVEX,
+		},
+		{
+			name: "csaf",
+			data: `{"document":{"title":"x"},"vulnerabilities":[]}`,
+			want: formatCSAF,
+		},
+		{
+			name:    "desconocido",
+			data:    `{"foo":"bar"}`,
+			wantErr: true,
+		},
+		{
+			name:    "json inválido",
+			data:    `{"statements":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := detectFormat([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("detectFormat(%q): esperaba error, no hubo", tt.data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("detectFormat(%q): error inesperado: %v", tt.data, err)
+			}
+			if got != tt.want {
+				t.Fatalf("detectFormat(%q) = %q, esperaba %q", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCSAFRoundTrip comprueba que decodeCSAF y buildCSAFDocument sean
+// inversas entre sí para las cuatro categorías de product_status.
+func TestCSAFRoundTrip(t *testing.T) {
+	input := `{
+		"document": {
+			"title": "herramienta-csaf",
+			"tracking": {"id": "DOC-1", "current_release_date": "2024-01-01T00:00:00Z"}
+		},
+		"vulnerabilities": [
+			{
+				"cve": "CVE-2024-1",
+				"title": "ejemplo",
+				"product_status": {
+					"known_affected": ["prod-a"],
+					"known_not_affected": ["prod-b"],
+					"fixed": ["prod-c"],
+					"under_investigation": ["prod-d"]
+				}
+			}
+		]
+	}`
+
+	vex, err := decodeCSAF([]byte(input))
+	if err != nil {
+		t.Fatalf("decodeCSAF devolvió un error: %v", err)
+	}
+	if len(vex.Statements) != 4 {
+		t.Fatalf("decodeCSAF produjo %d statements, esperaba 4", len(vex.Statements))
+	}
+
+	statusByProduct := make(map[string]string)
+	for _, s := range vex.Statements {
+		statusByProduct[s.Supplier] = s.Status
+	}
+	want := map[string]string{
+		"prod-a": "affected",
+		"prod-b": "not_affected",
+		"prod-c": "fixed",
+		"prod-d": "under_investigation",
+	}
+	for product, status := range want {
+		if statusByProduct[product] != status {
+			t.Errorf("status de %s = %q, esperaba %q", product, statusByProduct[product], status)
+		}
+	}
+
+	doc := buildCSAFDocument(vex)
+	if len(doc.Vulnerabilities) != 1 {
+		t.Fatalf("buildCSAFDocument produjo %d vulnerabilidades, esperaba 1", len(doc.Vulnerabilities))
+	}
+	ps := doc.Vulnerabilities[0].ProductStatus
+	if len(ps.KnownAffected) != 1 || ps.KnownAffected[0] != "prod-a" {
+		t.Errorf("known_affected = %v, esperaba [prod-a]", ps.KnownAffected)
+	}
+	if len(ps.KnownNotAffected) != 1 || ps.KnownNotAffected[0] != "prod-b" {
+		t.Errorf("known_not_affected = %v, esperaba [prod-b]", ps.KnownNotAffected)
+	}
+	if len(ps.Fixed) != 1 || ps.Fixed[0] != "prod-c" {
+		t.Errorf("fixed = %v, esperaba [prod-c]", ps.Fixed)
+	}
+	if len(ps.UnderInvestigation) != 1 || ps.UnderInvestigation[0] != "prod-d" {
+		t.Errorf("under_investigation = %v, esperaba [prod-d]", ps.UnderInvestigation)
+	}
+}
+
+func TestDecodeVEXAutoDetectsFormat(t *testing.T) {
+	data := []byte(`{"document":{"title":"x","tracking":{"id":"DOC-1"}},"vulnerabilities":[{"cve":"CVE-1","product_status":{"known_affected":["p"]}}]}`)
+
+	vex, detected, err := decodeVEX(data, formatAuto)
+	if err != nil {
+		t.Fatalf("decodeVEX devolvió un error: %v", err)
+	}
+	if detected != formatCSAF {
+		t.Fatalf("decodeVEX detectó %q, esperaba %q", detected, formatCSAF)
+	}
+	if len(vex.Statements) != 1 {
+		t.Fatalf("decodeVEX produjo %d statements, esperaba 1", len(vex.Statements))
+	}
+}
+
+// TestEncodeVEXLegacyDropsCSAFContext comprueba que transcodificar un CSAF a
+// legacy no filtre el marcador interno csafContext en el @context de salida.
+func TestEncodeVEXLegacyDropsCSAFContext(t *testing.T) {
+	vex, err := decodeCSAF([]byte(`{"document":{"title":"x","tracking":{"id":"DOC-1"}},"vulnerabilities":[]}`))
+	if err != nil {
+		t.Fatalf("decodeCSAF devolvió un error: %v", err)
+	}
+	if vex.Context != csafContext {
+		t.Fatalf("decodeCSAF no marcó Context como csafContext: %q", vex.Context)
+	}
+
+	data, err := encodeVEX(vex, formatLegacy)
+	if err != nil {
+		t.Fatalf("encodeVEX devolvió un error: %v", err)
+	}
+	if strings.Contains(string(data), csafContext) {
+		t.Fatalf("encodeVEX(legacy) filtró el marcador interno csafContext: %s", data)
+	}
+}
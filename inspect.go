@@ -0,0 +1,221 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// fileReport recoge, por archivo, las estadísticas que -inspect vuelca en
+// report.json: número de statements, histograma de status, si disparó el
+// warning de allNotAffected, y el error de parseo (con su offset en bytes
+// cuando es un *json.SyntaxError) si el archivo falló.
+type fileReport struct {
+	Path             string         `json:"path"`
+	Statements       int            `json:"statements,omitempty"`
+	StatusHistogram  map[string]int `json:"status_histogram,omitempty"`
+	AllNotAffected   bool           `json:"all_not_affected,omitempty"`
+	ParseError       string         `json:"parse_error,omitempty"`
+	ParseErrorOffset int64          `json:"parse_error_offset,omitempty"`
+}
+
+// inspectReport es el contenido de report.json: un registro por archivo
+// visto durante el run.
+type inspectReport struct {
+	Files []fileReport `json:"files"`
+}
+
+// inspectBundle construye el zip de -inspect de forma incremental y
+// streaming, al estilo del zip sellado que InspectDataHandler de minio
+// produce para depuración offline: cada vex.json y vex-modificado.json se
+// escribe en cuanto se procesa, y report.json/summary.txt se finalizan en
+// close(), de modo que un run en el que algunos archivos fallan sigue
+// dejando un bundle completo con esos errores en el reporte. El zip solo
+// queda cerrado (con su directorio central) cuando close() se ejecuta.
+type inspectBundle struct {
+	mu     sync.Mutex
+	f      *os.File
+	zw     *zip.Writer
+	report inspectReport
+}
+
+func newInspectBundle(dest string) (*inspectBundle, error) {
+	f, err := os.Create(dest)
+	if err != nil {
+		return nil, fmt.Errorf("error creando el bundle de -inspect %s: %v", dest, err)
+	}
+	return &inspectBundle{f: f, zw: zip.NewWriter(f)}, nil
+}
+
+func (b *inspectBundle) writeEntry(name string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	w, err := b.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// recordInput añade el vex.json original al bundle bajo inputs/.
+func (b *inspectBundle) recordInput(relPath string, data []byte) {
+	if err := b.writeEntry(filepath.ToSlash(filepath.Join("inputs", relPath)), data); err != nil {
+		fmt.Fprintf(os.Stderr, "Aviso: -inspect no pudo guardar la entrada de %s: %v\n", relPath, err)
+	}
+}
+
+// recordOutput añade el vex-modificado.json producido al bundle bajo outputs/.
+func (b *inspectBundle) recordOutput(relPath string, data []byte) {
+	if err := b.writeEntry(filepath.ToSlash(filepath.Join("outputs", relPath)), data); err != nil {
+		fmt.Fprintf(os.Stderr, "Aviso: -inspect no pudo guardar la salida de %s: %v\n", relPath, err)
+	}
+}
+
+// recordStats añade al reporte las estadísticas de un archivo procesado con éxito.
+func (b *inspectBundle) recordStats(relPath string, vex VEX) {
+	histogram := make(map[string]int)
+	allNotAffected := true
+	for _, s := range vex.Statements {
+		histogram[s.Status]++
+		if s.Status != "not_affected" {
+			allNotAffected = false
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.report.Files = append(b.report.Files, fileReport{
+		Path:            relPath,
+		Statements:      len(vex.Statements),
+		StatusHistogram: histogram,
+		AllNotAffected:  allNotAffected,
+	})
+}
+
+// recordParseError añade una entrada de error al reporte, incluyendo el
+// offset en bytes cuando err es un *json.SyntaxError.
+func (b *inspectBundle) recordParseError(relPath string, err error) {
+	fr := fileReport{Path: relPath, ParseError: err.Error()}
+	var syn *json.SyntaxError
+	if errors.As(err, &syn) {
+		fr.ParseErrorOffset = syn.Offset
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.report.Files = append(b.report.Files, fr)
+}
+
+// close finaliza report.json y summary.txt, después de todas las entradas y
+// con lo acumulado hasta ese momento, y cierra el zip. Si el proceso termina
+// sin pasar por close() (p. ej. una señal fuera de -watch), el archivo queda
+// con las entradas inputs/outputs ya escritas pero sin report.json,
+// summary.txt ni directorio central.
+func (b *inspectBundle) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if reportData, err := json.MarshalIndent(b.report, "", "  "); err == nil {
+		if w, werr := b.zw.Create("report.json"); werr == nil {
+			w.Write(reportData)
+		}
+	}
+
+	if w, werr := b.zw.Create("summary.txt"); werr == nil {
+		w.Write([]byte(buildSummary(b.report)))
+	}
+
+	if err := b.zw.Close(); err != nil {
+		return err
+	}
+	return b.f.Close()
+}
+
+// buildSummary arma el digest humano de summary.txt a partir del reporte acumulado.
+func buildSummary(report inspectReport) string {
+	var sb strings.Builder
+	errCount := 0
+	statementTotal := 0
+	notAffectedCount := 0
+	histogram := make(map[string]int)
+
+	for _, f := range report.Files {
+		if f.ParseError != "" {
+			errCount++
+			continue
+		}
+		statementTotal += f.Statements
+		if f.AllNotAffected {
+			notAffectedCount++
+		}
+		for status, n := range f.StatusHistogram {
+			histogram[status] += n
+		}
+	}
+
+	fmt.Fprintf(&sb, "Resumen de ejecución de VexRefiner\n")
+	fmt.Fprintf(&sb, "Archivos vistos: %d\n", len(report.Files))
+	fmt.Fprintf(&sb, "Archivos con error de parseo: %d\n", errCount)
+	fmt.Fprintf(&sb, "Statements totales: %d\n", statementTotal)
+	fmt.Fprintf(&sb, "Archivos con todas las vulnerabilidades 'not_affected': %d\n", notAffectedCount)
+	fmt.Fprintf(&sb, "Histograma de status:\n")
+	for status, n := range histogram {
+		fmt.Fprintf(&sb, "  %s: %d\n", status, n)
+	}
+
+	return sb.String()
+}
+
+// processForInspect repite el pipeline de lectura/transformación de
+// inputFile para capturar, además del mensaje de estado habitual que ya
+// produce processFile/processToSink, los bytes de entrada y salida y las
+// estadísticas que necesita el bundle de -inspect. Se mantiene separado de
+// processFile para no acoplar ese camino (ya usado por -o y el modo por
+// defecto) al de diagnóstico.
+func processForInspect(bundle *inspectBundle, root, inputFile string, inputFormat, outputFormat vexFormat) {
+	relPath, err := filepath.Rel(root, inputFile)
+	if err != nil {
+		relPath = filepath.Base(inputFile)
+	}
+
+	data, err := ioutil.ReadFile(inputFile)
+	if err != nil {
+		bundle.recordParseError(relPath, err)
+		return
+	}
+	bundle.recordInput(relPath, data)
+
+	var probe interface{}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		bundle.recordParseError(relPath, err)
+		return
+	}
+
+	vex, detected, err := decodeVEX(data, inputFormat)
+	if err != nil {
+		bundle.recordParseError(relPath, err)
+		return
+	}
+
+	vex, err = transform(inputFile, vex)
+	if err != nil {
+		bundle.recordParseError(relPath, err)
+		return
+	}
+
+	outputData, err := encodeVEX(vex, effectiveOutputFormat(outputFormat, detected))
+	if err != nil {
+		bundle.recordParseError(relPath, err)
+		return
+	}
+
+	bundle.recordOutput(relPath, outputData)
+	bundle.recordStats(relPath, vex)
+}
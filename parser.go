@@ -2,14 +2,17 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/fs"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/briandowns/spinner"
@@ -42,41 +45,51 @@ type Vulnerability struct {
 	Description string `json:"description"`
 }
 
-// parseAndFormatTime parsea una fecha en el formato original y la convierte a RFC3339 con Z
+// timeLayouts son los formatos de fecha que parseAndFormatTime prueba en
+// orden: el formato original de VexRefiner, los layouts RFC3339 que ya traen
+// OpenVEX y CSAF, y por último el formato ISO sin zona horaria.
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.000000",
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+}
+
+// parseAndFormatTime parsea una fecha probando timeLayouts en orden (con los
+// segundos Unix como última alternativa numérica) y la convierte a RFC3339 con Z
 func parseAndFormatTime(original string) (string, error) {
-	layout := "2006-01-02 15:04:05.000000"
-	t, err := time.Parse(layout, original)
-	if err != nil {
-		return "", err
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, original); err == nil {
+			return normalizeTimestamp(t), nil
+		}
+	}
+	if secs, err := strconv.ParseInt(original, 10, 64); err == nil {
+		return normalizeTimestamp(time.Unix(secs, 0)), nil
 	}
+	return "", fmt.Errorf("no se reconoce el formato de fecha %q", original)
+}
+
+// normalizeTimestamp formatea t como RFC3339 en UTC, forzando el sufijo Z.
+func normalizeTimestamp(t time.Time) string {
 	rfc := t.UTC().Format(time.RFC3339Nano)
 	if !strings.HasSuffix(rfc, "Z") {
 		rfc = rfc + "Z"
 	}
-	return rfc, nil
+	return rfc
 }
 
-// processFile procesa un solo archivo vex.json y genera el archivo modificado
-func processFile(inputFile, outputFile string) error {
-	data, err := ioutil.ReadFile(inputFile)
-	if err != nil {
-		return fmt.Errorf("error leyendo el archivo %s: %v", inputFile, err)
-	}
-
-	var vex VEX
-	err = json.Unmarshal(data, &vex)
-	if err != nil {
-		return fmt.Errorf("error al parsear JSON en %s: %v", inputFile, err)
-	}
-
+// transform aplica la normalización de timestamps a un VEX ya decodificado y
+// devuelve la copia convertida. inputFile solo se usa para enriquecer los
+// mensajes de error.
+func transform(inputFile string, vex VEX) (VEX, error) {
 	// Convertir timestamp principal
 	newMainTimestamp, err := parseAndFormatTime(vex.Timestamp)
 	if err != nil {
-		return fmt.Errorf("error al formatear timestamp principal en %s: %v", inputFile, err)
+		return vex, fmt.Errorf("error al formatear timestamp principal en %s: %v", inputFile, err)
 	}
 	newMainLastUpdated, err := parseAndFormatTime(vex.LastUpdated)
 	if err != nil {
-		return fmt.Errorf("error al formatear last_updated principal en %s: %v", inputFile, err)
+		return vex, fmt.Errorf("error al formatear last_updated principal en %s: %v", inputFile, err)
 	}
 	vex.Timestamp = newMainTimestamp
 	vex.LastUpdated = newMainLastUpdated
@@ -85,27 +98,23 @@ func processFile(inputFile, outputFile string) error {
 	for i := range vex.Statements {
 		newStatementTimestamp, err := parseAndFormatTime(vex.Statements[i].Timestamp)
 		if err != nil {
-			return fmt.Errorf("error al formatear timestamp en statement %d de %s: %v", i, inputFile, err)
+			return vex, fmt.Errorf("error al formatear timestamp en statement %d de %s: %v", i, inputFile, err)
 		}
 		newStatementLastUpdated, err := parseAndFormatTime(vex.Statements[i].LastUpdated)
 		if err != nil {
-			return fmt.Errorf("error al formatear last_updated en statement %d de %s: %v", i, inputFile, err)
+			return vex, fmt.Errorf("error al formatear last_updated en statement %d de %s: %v", i, inputFile, err)
 		}
 		vex.Statements[i].Timestamp = newStatementTimestamp
 		vex.Statements[i].LastUpdated = newStatementLastUpdated
 	}
 
-	outputData, err := json.MarshalIndent(vex, "", "  ")
-	if err != nil {
-		return fmt.Errorf("error al serializar a JSON en %s: %v", inputFile, err)
-	}
-
-	err = ioutil.WriteFile(outputFile, outputData, 0644)
-	if err != nil {
-		return fmt.Errorf("error al escribir el archivo %s: %v", outputFile, err)
-	}
+	return vex, nil
+}
 
-	// Comprobar si todas las vulnerabilidades tienen status: not_affected
+// statusMessage construye el mensaje de estado (warning o éxito) para un VEX
+// ya convertido, según si todas sus vulnerabilidades quedaron en
+// 'not_affected'.
+func statusMessage(inputFile string, vex VEX) string {
 	allNotAffected := true
 	for _, s := range vex.Statements {
 		if s.Status != "not_affected" {
@@ -115,93 +124,314 @@ func processFile(inputFile, outputFile string) error {
 	}
 
 	if allNotAffected {
-		// Mostrar un warning en amarillo
-		fmt.Printf("\033[33mWARNING: Todas las vulnerabilidades en %s tienen status 'not_affected', Guac no tendrá en cuenta este archivo.\033[0m\n", inputFile)
-	} else {
-		fmt.Printf("Proceso completado con éxito para %s.\n", inputFile)
+		return fmt.Sprintf("\033[33mWARNING: Todas las vulnerabilidades en %s tienen status 'not_affected', Guac no tendrá en cuenta este archivo.\033[0m", inputFile)
 	}
+	return fmt.Sprintf("Proceso completado con éxito para %s.", inputFile)
+}
 
-	return nil
+// readAndTransform lee inputFile, lo decodifica según inputFormat (auto
+// dispara la detección de esquema) y le aplica transform, sin decidir
+// todavía dónde ni en qué esquema se va a escribir el resultado. Devuelve
+// también el formato efectivamente usado para decodificar, de forma que el
+// caller pueda conservarlo como formato de salida por defecto.
+func readAndTransform(inputFile string, inputFormat vexFormat) (VEX, vexFormat, error) {
+	data, err := ioutil.ReadFile(inputFile)
+	if err != nil {
+		return VEX{}, "", fmt.Errorf("error leyendo el archivo %s: %v", inputFile, err)
+	}
+
+	vex, detected, err := decodeVEX(data, inputFormat)
+	if err != nil {
+		return VEX{}, "", fmt.Errorf("%s: %v", inputFile, err)
+	}
+
+	vex, err = transform(inputFile, vex)
+	if err != nil {
+		return VEX{}, "", err
+	}
+	return vex, detected, nil
+}
+
+// effectiveOutputFormat resuelve el esquema de salida: si outputFormat es
+// auto (o vacío) se conserva el esquema detectado en la entrada, para que la
+// herramienta solo transcodifique cuando el usuario lo pide explícitamente.
+func effectiveOutputFormat(outputFormat, detected vexFormat) vexFormat {
+	if outputFormat == formatAuto || outputFormat == "" {
+		return detected
+	}
+	return outputFormat
 }
 
+// processFile procesa un solo archivo vex.json y escribe el resultado
+// directamente en outputFile. Es el camino por defecto usado cuando no se
+// pasa -o: mantiene el comportamiento histórico de escribir
+// vex-modificado.json junto al archivo de entrada.
+func processFile(inputFile, outputFile string, inputFormat, outputFormat vexFormat) (string, error) {
+	vex, detected, err := readAndTransform(inputFile, inputFormat)
+	if err != nil {
+		return "", err
+	}
+
+	outputData, err := encodeVEX(vex, effectiveOutputFormat(outputFormat, detected))
+	if err != nil {
+		return "", fmt.Errorf("error al serializar a JSON en %s: %v", inputFile, err)
+	}
+
+	if err := ioutil.WriteFile(outputFile, outputData, 0644); err != nil {
+		return "", fmt.Errorf("error al escribir el archivo %s: %v", outputFile, err)
+	}
+
+	return statusMessage(inputFile, vex), nil
+}
+
+// processToSink procesa inputFile y delega la escritura del resultado a sink,
+// usando la ruta de inputFile relativa a root para preservar la estructura de
+// carpetas original (p. ej. dentro de un tar).
+func processToSink(root, inputFile string, sink outputSink, inputFormat, outputFormat vexFormat) (string, error) {
+	vex, detected, err := readAndTransform(inputFile, inputFormat)
+	if err != nil {
+		return "", err
+	}
+
+	relPath, err := filepath.Rel(root, inputFile)
+	if err != nil {
+		relPath = filepath.Base(inputFile)
+	}
+
+	if err := sink.put(relPath, vex, effectiveOutputFormat(outputFormat, detected)); err != nil {
+		return "", fmt.Errorf("error al escribir la salida de %s: %v", inputFile, err)
+	}
+
+	return statusMessage(inputFile, vex), nil
+}
+
+// runFolder reparte vexFiles entre jobs workers y dirige todos los mensajes
+// (avisos, líneas de éxito, errores) a través de un único goroutine de UI, de
+// forma que el bloque de estado "spinner k/N - archivos" sea siempre lo único
+// en la última fila de la terminal. Devuelve el número de archivos que
+// terminaron en error.
+func runFolder(root string, vexFiles []string, jobs int, sink outputSink, inputFormat, outputFormat vexFormat, inspect *inspectBundle) int {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	type job struct {
+		idx  int
+		file string
+	}
+
+	jobsCh := make(chan job)
+	events := make(chan uiEvent)
+
+	// El bloque de estado siempre va a stderr: cuando el sink escribe en
+	// stdout (-o - / -o type=stdout), el NDJSON que produce no puede
+	// compartir descriptor con las líneas de estado/aviso/error sin romper
+	// `vexrefiner -folder -o - | jq`.
+	ui := newStatusUI(os.Stderr, len(vexFiles))
+	uiDone := make(chan int, 1)
+	go func() {
+		uiDone <- ui.run(events)
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobsCh {
+				events <- uiEvent{kind: uiEventStarted, idx: j.idx, file: filepath.Base(j.file)}
+
+				var msg string
+				var err error
+				if sink != nil {
+					msg, err = processToSink(root, j.file, sink, inputFormat, outputFormat)
+				} else {
+					dir := filepath.Dir(j.file)
+					outputFile := filepath.Join(dir, "vex-modificado.json")
+					var safeOutput string
+					safeOutput, err = validateOutputPath(root, outputFile)
+					if err == nil {
+						msg, err = processFile(j.file, safeOutput, inputFormat, outputFormat)
+					}
+				}
+				if err != nil {
+					events <- uiEvent{kind: uiEventLine, line: err.Error(), isError: true}
+				} else {
+					events <- uiEvent{kind: uiEventLine, line: msg}
+				}
+
+				if inspect != nil {
+					processForInspect(inspect, root, j.file, inputFormat, outputFormat)
+				}
+
+				events <- uiEvent{kind: uiEventDone, idx: j.idx}
+			}
+		}()
+	}
+
+	go func() {
+		for idx, file := range vexFiles {
+			jobsCh <- job{idx: idx, file: file}
+		}
+		close(jobsCh)
+	}()
+
+	wg.Wait()
+	close(events)
+	return <-uiDone
+}
+
+// main delega en run y propaga su código de salida con os.Exit al final, de
+// forma que run() pueda retornar en cualquier punto (en vez de llamar a
+// os.Exit directamente) y sus defers -sink.close(), inspect.close()- se
+// ejecuten siempre antes de que el proceso termine.
 func main() {
+	os.Exit(run())
+}
+
+// run contiene toda la lógica de main y devuelve el código de salida del
+// proceso. Ningún camino dentro de run debe llamar a os.Exit: debe usar
+// return para que los defers registrados (cierre de sink e -inspect) corran.
+func run() int {
 	// Definir la bandera -folder
 	folderFlag := flag.Bool("folder", false, "Procesar todos los archivos vex.json en el directorio actual y subdirectorios")
+	jobsFlag := flag.Int("j", runtime.NumCPU(), "Número de archivos a procesar en paralelo en modo -folder")
+	outputFlag := flag.String("o", "", "Sink de salida: '-', 'type=local,dest=DIR', 'type=tar,dest=out.tar' o 'type=stdout'. Por defecto escribe vex-modificado.json junto a cada entrada")
+	rootFlag := flag.String("root", "", "Raíz segura del árbol a escanear en modo -folder (por defecto el directorio actual); los vex.json leídos y los vex-modificado.json escritos junto a ellos no pueden salir de aquí (los destinos de -o e -inspect se escriben donde se indique)")
+	followSymlinksFlag := flag.Bool("follow-symlinks", false, "Seguir symlinks al recorrer el árbol en modo -folder (por defecto no se siguen)")
+	watchFlag := flag.Bool("watch", false, "Tras el pase inicial de -folder, seguir vigilando el árbol y reprocesar cada vex.json que se cree o modifique")
+	inputFormatFlag := flag.String("input-format", string(formatAuto), "Esquema de entrada: auto, legacy, openvex o csaf")
+	outputFormatFlag := flag.String("output-format", string(formatAuto), "Esquema de salida: auto (igual que la entrada), legacy, openvex o csaf")
+	inspectFlag := flag.String("inspect", "", "Genera durante el run de -folder un zip de diagnóstico (vex.json de entrada, vex-modificado.json de salida, report.json y summary.txt) en la ruta indicada")
 	flag.Parse()
 
+	inputFormat, err := parseVexFormat(*inputFormatFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error en -input-format: %v\n", err)
+		return 1
+	}
+	outputFormat, err := parseVexFormat(*outputFormatFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error en -output-format: %v\n", err)
+		return 1
+	}
+
+	var sink outputSink
+	if *outputFlag != "" {
+		spec, err := parseOutputSpec(*outputFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error en -o: %v\n", err)
+			return 1
+		}
+		if spec.Type == "tar" && !*folderFlag && spec.Attrs["dest"] == "" {
+			fmt.Fprintln(os.Stderr, "Error en -o: type=tar requiere dest=archivo.tar en modo de archivo único")
+			return 1
+		}
+		sink, err = newOutputSink(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error en -o: %v\n", err)
+			return 1
+		}
+		defer sink.close()
+	}
+
+	var inspect *inspectBundle
+	if *inspectFlag != "" {
+		if !*folderFlag {
+			fmt.Fprintln(os.Stderr, "Error en -inspect: solo está disponible junto con -folder")
+			return 1
+		}
+		var err error
+		inspect, err = newInspectBundle(*inspectFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error en -inspect: %v\n", err)
+			return 1
+		}
+		defer inspect.close()
+	}
+
 	if *folderFlag {
 		// Procesar múltiples archivos de forma recursiva
 		currentDir, err := os.Getwd()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error obteniendo el directorio actual: %v\n", err)
-			os.Exit(1)
+			return 1
 		}
 
-		var vexFiles []string
+		root := currentDir
+		if *rootFlag != "" {
+			root = *rootFlag
+		}
+		root, err = filepath.EvalSymlinks(root)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resolviendo -root %s: %v\n", root, err)
+			return 1
+		}
 
-		// Recorrer directorios de forma recursiva para encontrar todos los vex.json
-		err = filepath.WalkDir(currentDir, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				// Si hay un error al acceder a un archivo/directorio, lo ignoramos y continuamos
-				fmt.Fprintf(os.Stderr, "Error accediendo a %s: %v\n", path, err)
-				return nil
-			}
-			if !d.IsDir() && d.Name() == "vex.json" {
-				vexFiles = append(vexFiles, path)
-			}
-			return nil
-		})
+		// Recorrer el árbol bajo root buscando vex.json, sin salirnos de root
+		// ni seguir symlinks salvo que -follow-symlinks esté activo.
+		vexFiles, err := walkVexFiles(root, *followSymlinksFlag)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error al recorrer los directorios: %v\n", err)
-			os.Exit(1)
+			return 1
 		}
 
 		if len(vexFiles) == 0 {
-			fmt.Println("No se encontraron archivos 'vex.json' en el directorio actual ni en sus subdirectorios.")
-			os.Exit(0)
+			fmt.Fprintf(os.Stderr, "No se encontraron archivos 'vex.json' en %s ni en sus subdirectorios.\n", root)
+			return 0
 		}
 
-		// Configurar el spinner
-		s := spinner.New(spinner.CharSets[9], 100*time.Millisecond) // CharSet 9 es "/-\|"
-		s.Prefix = fmt.Sprintf("Procesando archivos: 0/%d", len(vexFiles))
-		s.Start()
+		errCount := runFolder(root, vexFiles, *jobsFlag, sink, inputFormat, outputFormat, inspect)
+		// A stderr por la misma razón que el bloque de estado de runFolder:
+		// es ruido de progreso, no el resultado del comando, y no debe
+		// compartir descriptor con un sink que escribe datos en stdout.
+		fmt.Fprintln(os.Stderr, "Todos los archivos han sido procesados.")
 
-		for idx, file := range vexFiles {
-			// Actualizar el prefix del spinner
-			s.Prefix = fmt.Sprintf("Procesando archivos: %d/%d - %s", idx+1, len(vexFiles), filepath.Base(file))
-			// Determinar el archivo de salida en el mismo directorio
-			dir := filepath.Dir(file)
-			outputFile := filepath.Join(dir, "vex-modificado.json")
-			err := processFile(file, outputFile)
-			if err != nil {
-				s.Stop()
-				fmt.Fprintf(os.Stderr, "\n%s\n", err)
-				// Reiniciar el spinner después de un error
-				s.Start()
-				continue // Continuar con el siguiente archivo
+		if *watchFlag {
+			// -watch solo retorna por su cuenta si el watcher se cierra; el
+			// gesto normal para pararlo es Ctrl+C, así que capturamos esa
+			// señal (y SIGTERM) para que watchFolder retorne de forma
+			// ordenada y los defers de sink/-inspect se ejecuten en vez de
+			// que el proceso muera de golpe.
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(sigCh)
+
+			if err := watchFolder(root, *followSymlinksFlag, sink, inputFormat, outputFormat, sigCh); err != nil {
+				fmt.Fprintf(os.Stderr, "Error en -watch: %v\n", err)
+				return 1
 			}
+			return 0
 		}
 
-		s.Stop()
-		fmt.Println("Todos los archivos han sido procesados.")
+		if errCount > 0 {
+			return 1
+		}
 	} else {
 		// Procesar un solo archivo con interacción
 		reader := bufio.NewReader(os.Stdin)
 
-		// Preguntar por archivo a parsear
-		fmt.Print("Archivo a parsear [por defecto vex.json]: ")
+		// Los prompts van a stderr: si hay un sink de stdout de por medio
+		// (-o -), stdin/stdout siguen siendo el canal de datos y no pueden
+		// llevar también el texto de la interacción.
+		fmt.Fprint(os.Stderr, "Archivo a parsear [por defecto vex.json]: ")
 		inputFile, _ := reader.ReadString('\n')
 		inputFile = strings.TrimSpace(inputFile)
 		if inputFile == "" {
 			inputFile = "vex.json"
 		}
 
-		// Preguntar por archivo de salida
-		fmt.Print("Archivo output [por defecto vex-modificado.json]: ")
-		outputFile, _ := reader.ReadString('\n')
-		outputFile = strings.TrimSpace(outputFile)
-		if outputFile == "" {
-			outputFile = "vex-modificado.json"
+		// Preguntar por archivo de salida, salvo que -o ya decida dónde
+		// escribir: en ese caso outputFile nunca se usa y preguntar por él
+		// solo le pide al usuario una respuesta que se va a descartar.
+		outputFile := "vex-modificado.json"
+		if sink == nil {
+			fmt.Fprint(os.Stderr, "Archivo output [por defecto vex-modificado.json]: ")
+			answer, _ := reader.ReadString('\n')
+			answer = strings.TrimSpace(answer)
+			if answer != "" {
+				outputFile = answer
+			}
 		}
 
 		// Usar spinner para la animación de cargando
@@ -209,14 +439,29 @@ func main() {
 		s.Prefix = "Parseando fechas del vex "
 		s.Start()
 
-		err := processFile(inputFile, outputFile)
+		var msg string
+		var err error
+		if sink != nil {
+			msg, err = processToSink(filepath.Dir(inputFile), inputFile, sink, inputFormat, outputFormat)
+		} else {
+			msg, err = processFile(inputFile, outputFile, inputFormat, outputFormat)
+		}
 		if err != nil {
 			s.Stop()
 			fmt.Fprintf(os.Stderr, "\n%s\n", err)
-			os.Exit(1)
+			return 1
 		}
 
 		s.Stop()
+		// Con un sink activo el mensaje de estado no puede ir a stdout: si
+		// el sink es type=stdout, se entrelazaría con el NDJSON que acaba
+		// de escribir.
+		if sink != nil {
+			fmt.Fprintln(os.Stderr, msg)
+		} else {
+			fmt.Println(msg)
+		}
 	}
-}
 
+	return 0
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolveWithinRoot resuelve los symlinks tanto de root como de path y
+// comprueba que el resultado siga estando contenido en root, igual que la
+// verificación que minio añadió a InspectDataHandler para rutas file/volume.
+// Devuelve la ruta ya resuelta o un error si path escapa de root.
+func resolveWithinRoot(root, path string) (string, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("error resolviendo el root %s: %v", root, err)
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("error resolviendo %s: %v", path, err)
+	}
+	if err := requireContained(realRoot, realPath); err != nil {
+		return "", fmt.Errorf("%s escapa del root %s vía symlink", path, root)
+	}
+	return realPath, nil
+}
+
+// validateOutputPath resuelve el directorio donde se va a escribir
+// outputFile y comprueba que siga contenido en root antes de permitir la
+// escritura, ya que outputFile normalmente todavía no existe y por tanto no
+// se puede resolver directamente con EvalSymlinks.
+func validateOutputPath(root, outputFile string) (string, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("error resolviendo el root %s: %v", root, err)
+	}
+	realDir, err := filepath.EvalSymlinks(filepath.Dir(outputFile))
+	if err != nil {
+		return "", fmt.Errorf("error resolviendo el directorio de salida %s: %v", filepath.Dir(outputFile), err)
+	}
+	if err := requireContained(realRoot, realDir); err != nil {
+		return "", fmt.Errorf("el archivo de salida %s escapa del root %s", outputFile, root)
+	}
+	return filepath.Join(realDir, filepath.Base(outputFile)), nil
+}
+
+// requireContained devuelve un error si target no está contenido en root una
+// vez ambos resueltos (ni ".." ni una ruta absoluta distinta).
+func requireContained(root, target string) error {
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return fmt.Errorf("%s no está contenido en %s", target, root)
+	}
+	return nil
+}
+
+// walkVexFiles recorre root buscando archivos vex.json. Cuando followSymlinks
+// es false (el valor por defecto) los directorios y archivos alcanzados por
+// symlink se ignoran por completo; cuando es true, se siguen pero cada uno se
+// valida con resolveWithinRoot para impedir escapar del árbol de escaneo, y
+// un directorio alcanzado por symlink se descarta si su ruta real ya se
+// recorrió a través de otro symlink, para evitar bucles de symlinks. Los
+// directorios recorridos sin symlink no se registran, así que un symlink
+// hacia uno de ellos se recorre una vez más.
+func walkVexFiles(root string, followSymlinks bool) ([]string, error) {
+	var files []string
+	visited := make(map[string]bool)
+
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error accediendo a %s: %v\n", dir, err)
+			return nil
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+
+			if entry.Type()&fs.ModeSymlink != 0 {
+				if !followSymlinks {
+					continue
+				}
+				resolved, err := resolveWithinRoot(root, path)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Aviso: %v\n", err)
+					continue
+				}
+				info, err := os.Stat(resolved)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error accediendo a %s: %v\n", path, err)
+					continue
+				}
+				if info.IsDir() {
+					if visited[resolved] {
+						continue
+					}
+					visited[resolved] = true
+					if err := walk(path); err != nil {
+						return err
+					}
+					continue
+				}
+				if info.Name() == "vex.json" {
+					files = append(files, path)
+				}
+				continue
+			}
+
+			if entry.IsDir() {
+				if err := walk(path); err != nil {
+					return err
+				}
+				continue
+			}
+			if entry.Name() == "vex.json" {
+				files = append(files, path)
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRequireContained(t *testing.T) {
+	tests := []struct {
+		name    string
+		root    string
+		target  string
+		wantErr bool
+	}{
+		{"subdir", "/tmp/root", "/tmp/root/sub/vex.json", false},
+		{"same as root", "/tmp/root", "/tmp/root", false},
+		{"dot-dot escape", "/tmp/root", "/tmp/root/../other/vex.json", true},
+		{"sibling escape", "/tmp/root", "/tmp/other", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := requireContained(filepath.Clean(tt.root), filepath.Clean(tt.target))
+			if tt.wantErr && err == nil {
+				t.Fatalf("requireContained(%q, %q): esperaba error, no hubo", tt.root, tt.target)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("requireContained(%q, %q): error inesperado: %v", tt.root, tt.target, err)
+			}
+		})
+	}
+}
+
+// TestResolveWithinRootSymlinkEscape cubre el caso de seguridad que motivó
+// -follow-symlinks: un symlink dentro de root que apunta a un directorio
+// fuera de él no debe resolverse como contenido.
+func TestResolveWithinRootSymlinkEscape(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	link := filepath.Join(root, "escape")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatalf("error creando el symlink de prueba: %v", err)
+	}
+
+	if _, err := resolveWithinRoot(root, link); err == nil {
+		t.Fatalf("resolveWithinRoot debió rechazar un symlink que escapa de root")
+	}
+}
+
+// TestResolveWithinRootSymlinkContained comprueba que un symlink que apunta
+// dentro del propio root sí se acepte.
+func TestResolveWithinRootSymlinkContained(t *testing.T) {
+	root := t.TempDir()
+	realDir := filepath.Join(root, "real")
+	if err := os.Mkdir(realDir, 0755); err != nil {
+		t.Fatalf("error creando el directorio real: %v", err)
+	}
+
+	link := filepath.Join(root, "alias")
+	if err := os.Symlink(realDir, link); err != nil {
+		t.Fatalf("error creando el symlink de prueba: %v", err)
+	}
+
+	resolved, err := resolveWithinRoot(root, link)
+	if err != nil {
+		t.Fatalf("resolveWithinRoot rechazó un symlink contenido en root: %v", err)
+	}
+	if resolved == "" {
+		t.Fatalf("resolveWithinRoot devolvió una ruta vacía")
+	}
+}
+
+func TestValidateOutputPath(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatalf("error creando el subdirectorio: %v", err)
+	}
+
+	if _, err := validateOutputPath(root, filepath.Join(sub, "vex-modificado.json")); err != nil {
+		t.Fatalf("validateOutputPath rechazó una ruta contenida en root: %v", err)
+	}
+
+	outside := t.TempDir()
+	if _, err := validateOutputPath(root, filepath.Join(outside, "vex-modificado.json")); err == nil {
+		t.Fatalf("validateOutputPath debió rechazar una ruta fuera de root")
+	}
+}
+
+// TestWalkVexFilesSkipsSymlinksByDefault comprueba que, sin -follow-symlinks,
+// un vex.json solo alcanzable por symlink no se reporte.
+func TestWalkVexFilesSkipsSymlinksByDefault(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "vex.json"), []byte("{}"), 0644); err != nil {
+		t.Fatalf("error escribiendo vex.json de prueba: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatalf("error creando el symlink de prueba: %v", err)
+	}
+
+	files, err := walkVexFiles(root, false)
+	if err != nil {
+		t.Fatalf("walkVexFiles devolvió un error: %v", err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("walkVexFiles no debió seguir el symlink sin -follow-symlinks, encontró: %v", files)
+	}
+}
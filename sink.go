@@ -0,0 +1,175 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outputSpec es el resultado de parsear la bandera -o, al estilo de cómo
+// docker/buildkit interpreta "--output type=...,attr=valor" en pares
+// {Type, Attrs}.
+type outputSpec struct {
+	Type  string
+	Attrs map[string]string
+}
+
+// parseOutputSpec interpreta "-" (atajo de type=stdout),
+// "type=local,dest=DIR", "type=tar,dest=out.tar" o "type=stdout".
+func parseOutputSpec(s string) (outputSpec, error) {
+	if s == "-" {
+		return outputSpec{Type: "stdout", Attrs: map[string]string{}}, nil
+	}
+
+	attrs := make(map[string]string)
+	for _, field := range strings.Split(s, ",") {
+		if field == "" {
+			continue
+		}
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return outputSpec{}, fmt.Errorf("atributo de -o inválido %q, se esperaba key=value", field)
+		}
+		attrs[kv[0]] = kv[1]
+	}
+
+	typ, ok := attrs["type"]
+	if !ok {
+		return outputSpec{}, fmt.Errorf("-o requiere un atributo type=local|tar|stdout")
+	}
+	delete(attrs, "type")
+
+	return outputSpec{Type: typ, Attrs: attrs}, nil
+}
+
+// outputSink recibe cada VEX ya convertido junto con su ruta relativa
+// (rooted en el directorio de escaneo) y el esquema en el que debe
+// serializarse, y decide cómo persistirlo. Las implementaciones deben ser
+// seguras para llamadas concurrentes, ya que el pool de workers de -folder
+// escribe en el mismo sink desde varios goroutines.
+type outputSink interface {
+	put(relPath string, vex VEX, format vexFormat) error
+	close() error
+}
+
+// newOutputSink construye el sink correspondiente a spec.
+func newOutputSink(spec outputSpec) (outputSink, error) {
+	switch spec.Type {
+	case "local":
+		dest := spec.Attrs["dest"]
+		if dest == "" {
+			return nil, fmt.Errorf("-o type=local requiere dest=DIR")
+		}
+		return newLocalSink(dest)
+	case "tar":
+		dest := spec.Attrs["dest"]
+		if dest == "" {
+			return nil, fmt.Errorf("-o type=tar requiere dest=archivo.tar")
+		}
+		return newTarSink(dest)
+	case "stdout":
+		return newStdoutSink(), nil
+	default:
+		return nil, fmt.Errorf("tipo de -o desconocido %q (se esperaba local, tar o stdout)", spec.Type)
+	}
+}
+
+// localSink escribe cada VEX convertido como vex-modificado.json dentro de
+// dest, preservando la carpeta relativa de cada archivo de entrada.
+type localSink struct {
+	dest string
+}
+
+func newLocalSink(dest string) (*localSink, error) {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, fmt.Errorf("error creando el directorio de salida %s: %v", dest, err)
+	}
+	return &localSink{dest: dest}, nil
+}
+
+func (s *localSink) put(relPath string, vex VEX, format vexFormat) error {
+	data, err := encodeVEX(vex, format)
+	if err != nil {
+		return err
+	}
+	outPath := filepath.Join(s.dest, filepath.Dir(relPath), "vex-modificado.json")
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outPath, data, 0644)
+}
+
+func (s *localSink) close() error { return nil }
+
+// tarSink vuelca cada VEX convertido en un único archivo tar, preservando las
+// rutas relativas originales rooteadas en el directorio de escaneo.
+type tarSink struct {
+	mu sync.Mutex
+	f  *os.File
+	tw *tar.Writer
+}
+
+func newTarSink(dest string) (*tarSink, error) {
+	f, err := os.Create(dest)
+	if err != nil {
+		return nil, fmt.Errorf("error creando el tar de salida %s: %v", dest, err)
+	}
+	return &tarSink{f: f, tw: tar.NewWriter(f)}, nil
+}
+
+func (s *tarSink) put(relPath string, vex VEX, format vexFormat) error {
+	data, err := encodeVEX(vex, format)
+	if err != nil {
+		return err
+	}
+	name := filepath.ToSlash(filepath.Join(filepath.Dir(relPath), "vex-modificado.json"))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := s.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = s.tw.Write(data)
+	return err
+}
+
+func (s *tarSink) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.tw.Close(); err != nil {
+		return err
+	}
+	return s.f.Close()
+}
+
+// stdoutSink emite cada VEX convertido como una línea NDJSON en stdout, para
+// que la herramienta se pueda componer con pipelines de shell.
+type stdoutSink struct {
+	mu sync.Mutex
+}
+
+func newStdoutSink() *stdoutSink { return &stdoutSink{} }
+
+func (s *stdoutSink) put(relPath string, vex VEX, format vexFormat) error {
+	data, err := encodeVEXCompact(vex, format)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = os.Stdout.Write(append(data, '\n'))
+	return err
+}
+
+func (s *stdoutSink) close() error { return nil }
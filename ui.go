@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// uiEventKind identifica el tipo de evento que un worker reporta al renderizador.
+type uiEventKind int
+
+const (
+	uiEventStarted uiEventKind = iota
+	uiEventLine
+	uiEventDone
+)
+
+// uiEvent es el mensaje que los workers envían al goroutine de UI. Las líneas
+// terminadas (uiEventLine) se imprimen por encima del bloque de estado; los
+// eventos started/done solo actualizan el contador k/N y la lista de archivos
+// en curso.
+type uiEvent struct {
+	kind    uiEventKind
+	idx     int
+	file    string
+	line    string
+	isError bool
+}
+
+// statusUI renderiza un único bloque de estado (spinner + "k/N - archivos")
+// en la última fila de la terminal, al estilo del termstatus de restic: un
+// solo goroutine posee la terminal, así que las líneas impresas por distintos
+// workers nunca se entrelazan con el spinner. Cuando out (stderr en runFolder)
+// no es una TTY se degrada a un logging línea por línea sin control de cursor.
+type statusUI struct {
+	out        io.Writer
+	isTerminal bool
+	total      int
+
+	mu       sync.Mutex
+	done     int
+	inFlight map[int]string
+
+	lastWidth int
+}
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+func newStatusUI(out *os.File, total int) *statusUI {
+	fi, err := out.Stat()
+	isTerminal := err == nil && (fi.Mode()&os.ModeCharDevice) != 0
+	return &statusUI{
+		out:        out,
+		isTerminal: isTerminal,
+		total:      total,
+		inFlight:   make(map[int]string),
+	}
+}
+
+// run consume eventos hasta que events se cierra, redibujando el bloque de
+// estado tras cada línea impresa. Devuelve el número de errores reportados.
+func (u *statusUI) run(events <-chan uiEvent) int {
+	errCount := 0
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	frame := 0
+
+	render := func() {
+		if !u.isTerminal {
+			return
+		}
+		u.mu.Lock()
+		line := u.statusLineLocked(frame)
+		u.mu.Unlock()
+		u.clearStatusLine()
+		fmt.Fprint(u.out, line)
+		u.lastWidth = len(line)
+	}
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				u.clearStatusLine()
+				return errCount
+			}
+			switch ev.kind {
+			case uiEventStarted:
+				u.mu.Lock()
+				u.inFlight[ev.idx] = ev.file
+				u.mu.Unlock()
+				render()
+			case uiEventDone:
+				u.mu.Lock()
+				delete(u.inFlight, ev.idx)
+				u.done++
+				u.mu.Unlock()
+				render()
+			case uiEventLine:
+				if ev.isError {
+					errCount++
+				}
+				u.clearStatusLine()
+				fmt.Fprintln(u.out, ev.line)
+				render()
+			}
+		case <-ticker.C:
+			frame++
+			render()
+		}
+	}
+}
+
+// statusLineLocked construye la línea "spinner k/N - archivo1, archivo2".
+// El llamador debe mantener u.mu.
+func (u *statusUI) statusLineLocked(frame int) string {
+	names := make([]string, 0, len(u.inFlight))
+	idxs := make([]int, 0, len(u.inFlight))
+	for idx := range u.inFlight {
+		idxs = append(idxs, idx)
+	}
+	sort.Ints(idxs)
+	for _, idx := range idxs {
+		names = append(names, u.inFlight[idx])
+	}
+	spin := spinnerFrames[frame%len(spinnerFrames)]
+	return fmt.Sprintf("%s %d/%d - %s", spin, u.done, u.total, strings.Join(names, ", "))
+}
+
+// clearStatusLine borra la última línea dibujada antes de escribir algo nuevo,
+// de forma que el bloque de estado siga siendo lo único en la última fila.
+func (u *statusUI) clearStatusLine() {
+	if !u.isTerminal || u.lastWidth == 0 {
+		return
+	}
+	fmt.Fprint(u.out, "\r"+strings.Repeat(" ", u.lastWidth)+"\r")
+	u.lastWidth = 0
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce es la ventana de coalescencia usada para colapsar las
+// escrituras en ráfaga de un mismo vex.json en un único reproceso, al estilo
+// del "delay" de herramientas tipo fswatch.
+const watchDebounce = 100 * time.Millisecond
+
+// watchMaxBackoff acota el backoff exponencial que aplicamos cuando un
+// vex.json todavía se está escribiendo y su JSON sale incompleto.
+const watchMaxBackoff = time.Second
+
+// watchFolder mantiene el proceso vivo tras el pase inicial de -folder y
+// vuelve a ejecutar la conversión cada vez que un vex.json se crea o
+// modifica. Los subdirectorios nuevos se añaden al watch set de forma
+// recursiva y las escrituras rápidas se coalescen con un debounce por
+// archivo para no procesar dos veces el mismo evento. stop recibe la señal
+// de interrupción del usuario (Ctrl+C) para que watchFolder retorne de forma
+// ordenada en vez de dejar que el proceso muera y se salte los defers de
+// cierre de sink/-inspect registrados en run().
+func watchFolder(root string, followSymlinks bool, sink outputSink, inputFormat, outputFormat vexFormat, stop <-chan os.Signal) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error creando el watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	if err := addWatchDirs(watcher, root, root, followSymlinks); err != nil {
+		return err
+	}
+
+	// A stderr, no a stdout: es ruido de progreso, igual que el bloque de
+	// estado de -folder, y no puede compartir descriptor con un sink que
+	// escribe datos en stdout.
+	fmt.Fprintf(os.Stderr, "Vigilando %s en busca de cambios en vex.json (Ctrl+C para salir)...\n", root)
+
+	pending := make(map[string]*time.Timer)
+	trigger := make(chan string)
+
+	for {
+		select {
+		case <-stop:
+			fmt.Fprintln(os.Stderr, "\nDeteniendo -watch...")
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if event.Op&fsnotify.Create != 0 {
+				if info, statErr := os.Stat(event.Name); statErr == nil && info.IsDir() {
+					if err := addWatchDirs(watcher, root, event.Name, followSymlinks); err != nil {
+						fmt.Fprintf(os.Stderr, "%s\n", err)
+					}
+					continue
+				}
+			}
+
+			if filepath.Base(event.Name) != "vex.json" {
+				continue
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+				continue
+			}
+
+			name := event.Name
+			if t, ok := pending[name]; ok {
+				t.Stop()
+			}
+			pending[name] = time.AfterFunc(watchDebounce, func() {
+				trigger <- name
+			})
+
+		case name := <-trigger:
+			delete(pending, name)
+			processWatchedFile(root, name, sink, inputFormat, outputFormat)
+
+		case werr, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "Error del watcher: %v\n", werr)
+		}
+	}
+}
+
+// addWatchDirs añade dir (y recursivamente sus subdirectorios) al watcher,
+// respetando la misma política de symlinks que walkVexFiles: si
+// followSymlinks es false los symlinks se ignoran, y si es true se siguen
+// pero validando con resolveWithinRoot que no escapen de root.
+func addWatchDirs(watcher *fsnotify.Watcher, root, dir string, followSymlinks bool) error {
+	if err := watcher.Add(dir); err != nil {
+		return fmt.Errorf("error vigilando %s: %v", dir, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error accediendo a %s: %v\n", dir, err)
+		return nil
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if !followSymlinks {
+				continue
+			}
+			resolved, err := resolveWithinRoot(root, path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Aviso: %v\n", err)
+				continue
+			}
+			info, err := os.Stat(resolved)
+			if err != nil || !info.IsDir() {
+				continue
+			}
+			if err := addWatchDirs(watcher, root, path, followSymlinks); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+			}
+			continue
+		}
+
+		if entry.IsDir() {
+			if err := addWatchDirs(watcher, root, path, followSymlinks); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// processWatchedFile reprocesa un vex.json tras un evento del watcher,
+// reintentando con backoff exponencial (hasta watchMaxBackoff) cuando el
+// archivo todavía se está escribiendo y su JSON sale incompleto, antes de
+// darlo por fallido para ese evento.
+func processWatchedFile(root, file string, sink outputSink, inputFormat, outputFormat vexFormat) {
+	backoff := 50 * time.Millisecond
+	var msg string
+	var err error
+
+	for {
+		if sink != nil {
+			msg, err = processToSink(root, file, sink, inputFormat, outputFormat)
+		} else {
+			outputFile := filepath.Join(filepath.Dir(file), "vex-modificado.json")
+			var safeOutput string
+			safeOutput, err = validateOutputPath(root, outputFile)
+			if err == nil {
+				msg, err = processFile(file, safeOutput, inputFormat, outputFormat)
+			}
+		}
+
+		incomplete := err != nil && (strings.Contains(err.Error(), "parsear JSON") || strings.Contains(err.Error(), "parsear CSAF"))
+		if !incomplete || backoff > watchMaxBackoff {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+	// Igual que en el modo interactivo de archivo único: con un sink activo
+	// el mensaje de estado se va a stderr para no entrelazarse con datos
+	// que el sink pueda estar escribiendo en stdout.
+	if sink != nil {
+		fmt.Fprintln(os.Stderr, msg)
+	} else {
+		fmt.Println(msg)
+	}
+}